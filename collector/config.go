@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/alecthomas/kingpin/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// CollectorConfig is the per-collector configuration accepted via
+// --collector.config.file, keyed by collector name (e.g. "memory.stat").
+type CollectorConfig struct {
+	// ExcludeMetrics drops metrics whose field name matches one of these
+	// glob patterns (as understood by path.Match), e.g. "pgscan_direct"
+	// or "workingset_*".
+	ExcludeMetrics []string `yaml:"exclude_metrics"`
+}
+
+var configFile = kingpin.Flag("collector.config.file", "Path to a YAML (JSON is valid YAML) file with per-collector configuration, keyed by collector name.").String()
+
+// loadCollectorConfigs reads --collector.config.file, if set, and returns the
+// per-collector configuration it contains.
+func loadCollectorConfigs() (map[string]CollectorConfig, error) {
+	configs := make(map[string]CollectorConfig)
+	if *configFile == "" {
+		return configs, nil
+	}
+
+	data, err := os.ReadFile(*configFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collector.config.file %s: %w", *configFile, err)
+	}
+	if err := yaml.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse collector.config.file %s: %w", *configFile, err)
+	}
+	return configs, nil
+}
+
+// excludeMetricsFlag registers a per-collector --collector.<name>.exclude-metrics
+// flag, alongside the enable/disable flag registerCollector already sets up.
+func excludeMetricsFlag(collector string) *[]string {
+	flagName := fmt.Sprintf("collector.%s.exclude-metrics", collector)
+	flagHelp := fmt.Sprintf("Glob pattern of %s metrics to drop; may be repeated.", collector)
+	return kingpin.Flag(flagName, flagHelp).Strings()
+}
+
+// excludeMetricsFor merges the glob patterns configured for collector via
+// --collector.config.file with the ones given on the command line.
+func excludeMetricsFor(collector string, configs map[string]CollectorConfig, flagValues []string) []string {
+	var patterns []string
+	if cfg, ok := configs[collector]; ok {
+		patterns = append(patterns, cfg.ExcludeMetrics...)
+	}
+	patterns = append(patterns, flagValues...)
+	return patterns
+}
@@ -0,0 +1,67 @@
+package collector
+
+import (
+	"os"
+	"testing"
+)
+
+func TestExcludeMetricsFor(t *testing.T) {
+	configs := map[string]CollectorConfig{
+		"memory.stat": {ExcludeMetrics: []string{"workingset_*"}},
+	}
+
+	got := excludeMetricsFor("memory.stat", configs, []string{"pgscan_direct"})
+	want := []string{"workingset_*", "pgscan_direct"}
+	if len(got) != len(want) {
+		t.Fatalf("excludeMetricsFor() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("excludeMetricsFor()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestExcludeMetricsForNoConfig(t *testing.T) {
+	got := excludeMetricsFor("memory.stat", map[string]CollectorConfig{}, []string{"pgscan_direct"})
+	want := []string{"pgscan_direct"}
+	if len(got) != len(want) || got[0] != want[0] {
+		t.Errorf("excludeMetricsFor() with no file config = %v, want %v", got, want)
+	}
+}
+
+func TestLoadCollectorConfigsNoFile(t *testing.T) {
+	empty := ""
+	configFile = &empty
+
+	configs, err := loadCollectorConfigs()
+	if err != nil {
+		t.Fatalf("loadCollectorConfigs() error: %v", err)
+	}
+	if len(configs) != 0 {
+		t.Errorf("loadCollectorConfigs() with no --collector.config.file = %+v, want empty", configs)
+	}
+}
+
+func TestLoadCollectorConfigsFromFile(t *testing.T) {
+	path := t.TempDir() + "/config.yaml"
+	content := []byte("memory.stat:\n  exclude_metrics:\n    - workingset_*\n")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	configFile = &path
+	defer func() {
+		empty := ""
+		configFile = &empty
+	}()
+
+	configs, err := loadCollectorConfigs()
+	if err != nil {
+		t.Fatalf("loadCollectorConfigs() error: %v", err)
+	}
+	got := configs["memory.stat"].ExcludeMetrics
+	if len(got) != 1 || got[0] != "workingset_*" {
+		t.Errorf("loadCollectorConfigs()[\"memory.stat\"].ExcludeMetrics = %v, want [workingset_*]", got)
+	}
+}
@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+)
+
+var (
+	cgroupfsPath   = kingpin.Flag("path.cgroupfs", "cgroupv2 unified mount point.").Default("/sys/fs/cgroup").String()
+	cgroupInclude  = kingpin.Flag("collector.cgroup.include", "Regexp of cgroup paths (relative to path.cgroupfs) to include. Cgroups are included by default if this flag is unset.").String()
+	cgroupExclude  = kingpin.Flag("collector.cgroup.exclude", "Regexp of cgroup paths (relative to path.cgroupfs) to exclude. Takes precedence over collector.cgroup.include.").String()
+	cgroupMaxDepth = kingpin.Flag("collector.cgroup.max-depth", "Maximum directory depth to walk below path.cgroupfs when discovering cgroups.").Default("8").Int()
+)
+
+// cgroupDiscoverer walks the unified cgroup2 hierarchy on every scrape and
+// returns the set of cgroup directories matching the configured
+// include/exclude filters, so that cgroups created or removed between
+// scrapes are picked up without restarting the exporter.
+type cgroupDiscoverer struct {
+	root     string
+	include  *regexp.Regexp
+	exclude  *regexp.Regexp
+	maxDepth int
+	logger   log.Logger
+}
+
+func newCgroupDiscoverer(logger log.Logger) (*cgroupDiscoverer, error) {
+	var include, exclude *regexp.Regexp
+	var err error
+
+	if *cgroupInclude != "" {
+		if include, err = regexp.Compile(*cgroupInclude); err != nil {
+			return nil, fmt.Errorf("invalid collector.cgroup.include regexp: %w", err)
+		}
+	}
+	if *cgroupExclude != "" {
+		if exclude, err = regexp.Compile(*cgroupExclude); err != nil {
+			return nil, fmt.Errorf("invalid collector.cgroup.exclude regexp: %w", err)
+		}
+	}
+
+	return &cgroupDiscoverer{
+		root:     *cgroupfsPath,
+		include:  include,
+		exclude:  exclude,
+		maxDepth: *cgroupMaxDepth,
+		logger:   logger,
+	}, nil
+}
+
+// Discover walks the cgroup2 hierarchy rooted at d.root and returns every
+// descendant directory whose path relative to d.root matches the
+// include/exclude filters. d.root itself is never returned, since it is not
+// a cgroup. Symlinks are followed but a directory is never visited twice, so
+// a symlink loop cannot send the walk into an infinite recursion.
+func (d *cgroupDiscoverer) Discover() ([]string, error) {
+	visited := make(map[string]bool)
+	var dirs []string
+
+	var walk func(path string, depth int) error
+	walk = func(path string, depth int) error {
+		real, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return err
+		}
+		if visited[real] {
+			return nil
+		}
+		visited[real] = true
+
+		if depth > 0 && d.matches(path) {
+			dirs = append(dirs, path)
+		}
+		if depth >= d.maxDepth {
+			return nil
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			child := filepath.Join(path, entry.Name())
+			// entry.IsDir() reflects the lstat type bit, so it's false for a
+			// symlink even when it points at a directory; stat through the
+			// symlink instead so symlinked directories are still walked (and
+			// the visited-set loop guard above has something to guard).
+			info, err := os.Stat(child)
+			if err != nil {
+				level.Warn(d.logger).Log("msg", "failed to stat cgroup directory", "path", child, "err", err)
+				continue
+			}
+			if !info.IsDir() {
+				continue
+			}
+			if err := walk(child, depth+1); err != nil {
+				level.Warn(d.logger).Log("msg", "failed to walk cgroup directory", "path", child, "err", err)
+			}
+		}
+		return nil
+	}
+
+	if err := walk(d.root, 0); err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", d.root, err)
+	}
+	return dirs, nil
+}
+
+func (d *cgroupDiscoverer) matches(path string) bool {
+	rel, err := filepath.Rel(d.root, path)
+	if err != nil {
+		return false
+	}
+	if d.exclude != nil && d.exclude.MatchString(rel) {
+		return false
+	}
+	if d.include != nil && !d.include.MatchString(rel) {
+		return false
+	}
+	return true
+}
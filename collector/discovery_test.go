@@ -0,0 +1,137 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/prometheus/common/promlog"
+)
+
+var discoveryLogger = promlog.New(&promlog.Config{})
+
+func mustMkdirAll(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(path, 0o755); err != nil {
+		t.Fatalf("failed to create %s: %v", path, err)
+	}
+}
+
+func TestDiscoverSkipsRoot(t *testing.T) {
+	root := t.TempDir()
+	mustMkdirAll(t, filepath.Join(root, "a.slice", "b.scope"))
+
+	d := &cgroupDiscoverer{root: root, maxDepth: 8, logger: discoveryLogger}
+	got, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Discover() error: %v", err)
+	}
+
+	for _, path := range got {
+		if path == root {
+			t.Errorf("Discover() returned the mountpoint root %q, want only descendants", root)
+		}
+	}
+
+	want := []string{
+		filepath.Join(root, "a.slice"),
+		filepath.Join(root, "a.slice", "b.scope"),
+	}
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("Discover() = %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("Discover()[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDiscoverMaxDepth(t *testing.T) {
+	root := t.TempDir()
+	mustMkdirAll(t, filepath.Join(root, "a", "b", "c"))
+
+	d := &cgroupDiscoverer{root: root, maxDepth: 1, logger: discoveryLogger}
+	got, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Discover() error: %v", err)
+	}
+
+	want := []string{filepath.Join(root, "a")}
+	if len(got) != len(want) || got[0] != want[0] {
+		t.Errorf("Discover() with maxDepth 1 = %v, want %v", got, want)
+	}
+}
+
+func TestDiscoverFollowsSymlinkedDirectory(t *testing.T) {
+	root := t.TempDir()
+	target := t.TempDir()
+	mustMkdirAll(t, filepath.Join(target, "real.scope"))
+	if err := os.Symlink(target, filepath.Join(root, "linked")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	d := &cgroupDiscoverer{root: root, maxDepth: 8, logger: discoveryLogger}
+	got, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Discover() error: %v", err)
+	}
+
+	want := filepath.Join(root, "linked", "real.scope")
+	var found bool
+	for _, path := range got {
+		if path == want {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Discover() = %v, want it to include %q behind a symlinked directory", got, want)
+	}
+}
+
+func TestDiscoverSymlinkLoop(t *testing.T) {
+	root := t.TempDir()
+	mustMkdirAll(t, filepath.Join(root, "a"))
+	if err := os.Symlink(root, filepath.Join(root, "a", "loop")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	// Without the visited-path guard, walking "loop" would recurse back into
+	// root again and again until maxDepth stops it, returning an entry for
+	// nearly every level; assert the result stays small.
+	d := &cgroupDiscoverer{root: root, maxDepth: 20, logger: discoveryLogger}
+	got, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Discover() error: %v", err)
+	}
+	if len(got) > 4 {
+		t.Errorf("Discover() with a symlink loop returned %d entries, want a small finite set: %v", len(got), got)
+	}
+}
+
+func TestDiscoverInclude(t *testing.T) {
+	root := t.TempDir()
+	mustMkdirAll(t, filepath.Join(root, "kubepods.slice", "foo.scope"))
+	mustMkdirAll(t, filepath.Join(root, "system.slice", "bar.service"))
+
+	d, err := newCgroupDiscoverer(discoveryLogger)
+	if err != nil {
+		t.Fatalf("newCgroupDiscoverer() error: %v", err)
+	}
+	d.root = root
+	d.include = regexp.MustCompile("^kubepods")
+
+	got, err := d.Discover()
+	if err != nil {
+		t.Fatalf("Discover() error: %v", err)
+	}
+	for _, path := range got {
+		if filepath.Base(filepath.Dir(path)) == "system.slice" || filepath.Base(path) == "system.slice" {
+			t.Errorf("Discover() with include=^kubepods returned excluded path %q", path)
+		}
+	}
+}
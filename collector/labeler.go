@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+)
+
+// cgroupLabelKeys enumerates every label a labeler may attach to a cgroup.
+// Every cgroup gets all of these labels, blank where not recognized, so a
+// given metric name always has the same label schema regardless of which
+// cgroups it happened to see this scrape.
+var cgroupLabelKeys = []string{
+	"systemd_unit",
+	"slice",
+	"pod_uid",
+	"qos_class",
+	"container_id",
+	"container_runtime",
+}
+
+// labeler turns a cgroup path (relative to path.cgroupfs) into structured
+// labels, so the exporter's output can be joined with kube-state-metrics or
+// systemd dashboards instead of relying on an opaque sanitized basename.
+type labeler interface {
+	name() string
+	labels(path string) map[string]string
+}
+
+var labelerDisable = kingpin.Flag("collector.labeler.disable", "Name of a built-in cgroup labeler to disable (systemd, kubepods, libpod); may be repeated.").Strings()
+
+var builtinLabelers = []labeler{systemdLabeler{}, kubepodsLabeler{}, libpodLabeler{}}
+
+// enabledLabelers returns the built-in labelers not named in
+// --collector.labeler.disable.
+func enabledLabelers() []labeler {
+	disabled := make(map[string]bool, len(*labelerDisable))
+	for _, name := range *labelerDisable {
+		disabled[name] = true
+	}
+
+	var enabled []labeler
+	for _, l := range builtinLabelers {
+		if !disabled[l.name()] {
+			enabled = append(enabled, l)
+		}
+	}
+	return enabled
+}
+
+// cgroupLabels runs path through every given labeler, merges the results,
+// and fills in any key from cgroupLabelKeys left unset so every cgroup
+// produces the same label schema.
+func cgroupLabels(labelers []labeler, path string) map[string]string {
+	labels := make(map[string]string, len(cgroupLabelKeys))
+	for _, l := range labelers {
+		for k, v := range l.labels(path) {
+			labels[k] = v
+		}
+	}
+	for _, k := range cgroupLabelKeys {
+		if _, ok := labels[k]; !ok {
+			labels[k] = ""
+		}
+	}
+	return labels
+}
+
+// systemdLabeler recognizes plain systemd units, e.g.
+// "system.slice/foo.service" or "user.slice/user-1000.slice/session-1.scope".
+type systemdLabeler struct{}
+
+func (systemdLabeler) name() string { return "systemd" }
+
+func (systemdLabeler) labels(path string) map[string]string {
+	base := filepath.Base(path)
+	// Slices are containers of other units, not a workload themselves;
+	// leave them to whichever labeler below recognizes the slice layout.
+	if !strings.HasSuffix(base, ".service") && !strings.HasSuffix(base, ".scope") {
+		return nil
+	}
+	return map[string]string{
+		"systemd_unit": base,
+		"slice":        filepath.Base(filepath.Dir(path)),
+	}
+}
+
+// kubepodsLabeler recognizes kubelet-managed cgroups under kubepods(.slice),
+// for both the systemd and cgroupfs cgroup drivers, e.g.:
+//
+//	kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod<uid>.slice/cri-containerd-<id>.scope
+//	kubepods/burstable/pod<uid>/<id>
+type kubepodsLabeler struct{}
+
+func (kubepodsLabeler) name() string { return "kubepods" }
+
+var (
+	kubepodsSystemdPodRegexp  = regexp.MustCompile(`kubepods-(besteffort|burstable|guaranteed)-pod([a-f0-9_]+)\.slice`)
+	kubepodsCgroupfsPodRegexp = regexp.MustCompile(`kubepods/(besteffort|burstable|guaranteed)?/?pod([a-f0-9-]+)(?:/|$)`)
+	// containerScopeRegexp matches the systemd-driver container scope name,
+	// e.g. "cri-containerd-<id>.scope" or "docker-<id>.scope".
+	containerScopeRegexp = regexp.MustCompile(`(?:cri-containerd|docker|crio)-([a-f0-9]+)\.scope$`)
+	// bareContainerIDRegexp matches the cgroupfs-driver container directory
+	// name, which is just the bare container ID with no runtime prefix or
+	// ".scope" suffix, e.g. "kubepods/burstable/pod<uid>/<id>".
+	bareContainerIDRegexp = regexp.MustCompile(`^[a-f0-9]{64}$`)
+)
+
+func (kubepodsLabeler) labels(path string) map[string]string {
+	if !strings.Contains(path, "kubepods") {
+		return nil
+	}
+
+	labels := map[string]string{}
+	switch {
+	case kubepodsSystemdPodRegexp.MatchString(path):
+		m := kubepodsSystemdPodRegexp.FindStringSubmatch(path)
+		labels["qos_class"] = m[1]
+		labels["pod_uid"] = strings.ReplaceAll(m[2], "_", "-")
+		if m := containerScopeRegexp.FindStringSubmatch(path); m != nil {
+			labels["container_id"] = m[1]
+		}
+	case kubepodsCgroupfsPodRegexp.MatchString(path):
+		m := kubepodsCgroupfsPodRegexp.FindStringSubmatch(path)
+		if m[1] == "" {
+			m[1] = "guaranteed"
+		}
+		labels["qos_class"] = m[1]
+		labels["pod_uid"] = m[2]
+		if m := bareContainerIDRegexp.FindStringSubmatch(filepath.Base(path)); m != nil {
+			labels["container_id"] = m[0]
+		}
+	default:
+		// Somewhere above the per-pod cgroup, e.g. kubepods.slice itself.
+		return nil
+	}
+
+	return labels
+}
+
+// libpodLabeler recognizes libpod/docker container scopes under
+// machine.slice, e.g. "machine.slice/libpod-<id>.scope".
+type libpodLabeler struct{}
+
+func (libpodLabeler) name() string { return "libpod" }
+
+var libpodScopeRegexp = regexp.MustCompile(`^(libpod|docker)-([a-f0-9]+)\.scope$`)
+
+func (libpodLabeler) labels(path string) map[string]string {
+	m := libpodScopeRegexp.FindStringSubmatch(filepath.Base(path))
+	if m == nil {
+		return nil
+	}
+	runtime := "docker"
+	if m[1] == "libpod" {
+		runtime = "podman"
+	}
+	return map[string]string{
+		"container_runtime": runtime,
+		"container_id":      m[2],
+	}
+}
@@ -0,0 +1,124 @@
+package collector
+
+import (
+	"testing"
+)
+
+func TestSystemdLabeler(t *testing.T) {
+	cases := []struct {
+		path string
+		want map[string]string
+	}{
+		{
+			path: "system.slice/foo.service",
+			want: map[string]string{"systemd_unit": "foo.service", "slice": "system.slice"},
+		},
+		{
+			path: "user.slice/user-1000.slice/session-1.scope",
+			want: map[string]string{"systemd_unit": "session-1.scope", "slice": "user-1000.slice"},
+		},
+		{
+			path: "system.slice",
+			want: nil,
+		},
+	}
+
+	for _, c := range cases {
+		got := systemdLabeler{}.labels(c.path)
+		if len(got) != len(c.want) {
+			t.Errorf("labels(%q) = %+v, want %+v", c.path, got, c.want)
+			continue
+		}
+		for k, v := range c.want {
+			if got[k] != v {
+				t.Errorf("labels(%q)[%q] = %q, want %q", c.path, k, got[k], v)
+			}
+		}
+	}
+}
+
+func TestKubepodsLabelerSystemdDriver(t *testing.T) {
+	path := "kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234_5678.slice/cri-containerd-abcdef0123456789.scope"
+	got := kubepodsLabeler{}.labels(path)
+	want := map[string]string{
+		"qos_class":    "burstable",
+		"pod_uid":      "1234-5678",
+		"container_id": "abcdef0123456789",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("labels(%q)[%q] = %q, want %q", path, k, got[k], v)
+		}
+	}
+}
+
+func TestKubepodsLabelerCgroupfsDriver(t *testing.T) {
+	containerID := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	path := "kubepods/burstable/pod1234-5678/" + containerID
+	got := kubepodsLabeler{}.labels(path)
+	want := map[string]string{
+		"qos_class":    "burstable",
+		"pod_uid":      "1234-5678",
+		"container_id": containerID,
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("labels(%q)[%q] = %q, want %q", path, k, got[k], v)
+		}
+	}
+}
+
+func TestKubepodsLabelerAbovePod(t *testing.T) {
+	got := kubepodsLabeler{}.labels("kubepods.slice/kubepods-burstable.slice")
+	if got != nil {
+		t.Errorf("labels() for a cgroup above the per-pod level = %+v, want nil", got)
+	}
+}
+
+func TestLibpodLabeler(t *testing.T) {
+	cases := []struct {
+		path string
+		want map[string]string
+	}{
+		{
+			path: "machine.slice/libpod-abcdef0123456789.scope",
+			want: map[string]string{"container_runtime": "podman", "container_id": "abcdef0123456789"},
+		},
+		{
+			path: "machine.slice/docker-abcdef0123456789.scope",
+			want: map[string]string{"container_runtime": "docker", "container_id": "abcdef0123456789"},
+		},
+		{
+			path: "machine.slice",
+			want: nil,
+		},
+	}
+
+	for _, c := range cases {
+		got := libpodLabeler{}.labels(c.path)
+		if len(got) != len(c.want) {
+			t.Errorf("labels(%q) = %+v, want %+v", c.path, got, c.want)
+			continue
+		}
+		for k, v := range c.want {
+			if got[k] != v {
+				t.Errorf("labels(%q)[%q] = %q, want %q", c.path, k, got[k], v)
+			}
+		}
+	}
+}
+
+func TestCgroupLabelsFillsUnsetKeys(t *testing.T) {
+	labels := cgroupLabels([]labeler{systemdLabeler{}}, "system.slice/foo.service")
+	for _, k := range cgroupLabelKeys {
+		if _, ok := labels[k]; !ok {
+			t.Errorf("cgroupLabels() missing key %q, got %+v", k, labels)
+		}
+	}
+	if labels["systemd_unit"] != "foo.service" {
+		t.Errorf("cgroupLabels()[\"systemd_unit\"] = %q, want %q", labels["systemd_unit"], "foo.service")
+	}
+	if labels["container_id"] != "" {
+		t.Errorf("cgroupLabels()[\"container_id\"] = %q, want empty", labels["container_id"])
+	}
+}
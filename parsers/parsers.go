@@ -5,31 +5,105 @@ import (
 	"fmt"
 	"io"
 	"math"
+	"path"
 	"strconv"
 	"strings"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
+// Metric is a single sample extracted from a cgroup file. Labels never
+// includes the "cgroup" label; that is added by the caller, which is the
+// only thing that knows which cgroup directory was being read.
+type Metric struct {
+	Name      string
+	Value     float64
+	Labels    map[string]string
+	ValueType prometheus.ValueType
+}
+
 // Parser defines the interface for file parsers.
 type Parser interface {
-	Parse(io.Reader) (map[string]float64, error)
+	Parse(io.Reader) ([]Metric, error)
 }
 
 type SingleValueParser struct {
 	MetricPrefix string
 	Logger       log.Logger
+	// ValueType is the metric's prometheus.ValueType. Defaults to GaugeValue
+	// when unset.
+	ValueType prometheus.ValueType
+	// ExcludeMetrics is a list of glob patterns (as understood by
+	// path.Match); a metric whose field name matches one of them is
+	// dropped instead of parsed.
+	ExcludeMetrics []string
 }
 
 type FlatKeyValueParser struct {
 	MetricPrefix string
 	Logger       log.Logger
+	// ValueTypes maps a field name to the prometheus.ValueType it should be
+	// exported as. Fields not present default to GaugeValue.
+	ValueTypes map[string]prometheus.ValueType
+	// ExcludeMetrics is a list of glob patterns (as understood by
+	// path.Match) matched against each line's field name; matching fields
+	// are dropped instead of parsed.
+	ExcludeMetrics []string
 }
 
 type NestedKeyValueParser struct {
 	MetricPrefix string
 	Logger       log.Logger
+	// ValueTypes maps an inner field name (e.g. "total") to the
+	// prometheus.ValueType it should be exported as. Fields not present
+	// default to GaugeValue.
+	ValueTypes map[string]prometheus.ValueType
+	// ExcludeMetrics is a list of glob patterns (as understood by
+	// path.Match) matched against each inner field name; matching fields
+	// are dropped instead of parsed.
+	ExcludeMetrics []string
+}
+
+// DeviceKeyValueParser parses files where each line starts with a "MAJ:MIN"
+// device identifier followed by Key=Value fields, e.g. io.stat:
+//
+//	254:0 rbytes=1206272 wbytes=0 rios=12 wios=0 dbytes=0 dios=0
+//
+// The device identifier is exported as a "device" label rather than being
+// flattened into the metric name, since a cgroup can report stats for
+// several devices in the same file.
+type DeviceKeyValueParser struct {
+	MetricPrefix string
+	Logger       log.Logger
+	// ValueTypes maps a field name (e.g. "rbytes") to the
+	// prometheus.ValueType it should be exported as. Fields not present
+	// default to GaugeValue.
+	ValueTypes map[string]prometheus.ValueType
+	// ExcludeMetrics is a list of glob patterns (as understood by
+	// path.Match) matched against each field name; matching fields are
+	// dropped instead of parsed.
+	ExcludeMetrics []string
+}
+
+// valueType defaults an unset prometheus.ValueType (its zero value) to
+// GaugeValue, since the prometheus package itself treats 0 as invalid.
+func valueType(vt prometheus.ValueType) prometheus.ValueType {
+	if vt == 0 {
+		return prometheus.GaugeValue
+	}
+	return vt
+}
+
+// excluded reports whether name matches one of the given glob patterns.
+func excluded(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, name); err == nil && ok {
+			return true
+		}
+	}
+	return false
 }
 
 func readContent(file io.Reader) (string, error) {
@@ -43,7 +117,11 @@ func readContent(file io.Reader) (string, error) {
 	return strings.TrimSpace(content.String()), nil
 }
 
-func (p *SingleValueParser) Parse(file io.Reader) (map[string]float64, error) {
+func (p *SingleValueParser) Parse(file io.Reader) ([]Metric, error) {
+	if excluded(p.ExcludeMetrics, p.MetricPrefix) {
+		return nil, nil
+	}
+
 	content, err := readContent(file)
 	if err != nil {
 		level.Error(p.Logger).Log("msg", "Error reading file", "err", err)
@@ -52,7 +130,7 @@ func (p *SingleValueParser) Parse(file io.Reader) (map[string]float64, error) {
 	// Check if content is "max" and convert it to +Inf
 	if content == "max" {
 		level.Debug(p.Logger).Log("msg", "Converting max to +Inf")
-		return map[string]float64{p.MetricPrefix: math.Inf(1)}, nil
+		return []Metric{{Name: p.MetricPrefix, Value: math.Inf(1), ValueType: valueType(p.ValueType)}}, nil
 	}
 
 	value, err := strconv.ParseFloat(content, 64)
@@ -60,11 +138,11 @@ func (p *SingleValueParser) Parse(file io.Reader) (map[string]float64, error) {
 		level.Error(p.Logger).Log("err", err)
 		return nil, err
 	}
-	return map[string]float64{p.MetricPrefix: value}, nil
+	return []Metric{{Name: p.MetricPrefix, Value: value, ValueType: valueType(p.ValueType)}}, nil
 }
 
-func (p *FlatKeyValueParser) Parse(file io.Reader) (map[string]float64, error) {
-	metrics := map[string]float64{}
+func (p *FlatKeyValueParser) Parse(file io.Reader) ([]Metric, error) {
+	var metrics []Metric
 
 	// Read the file line by line and parse PSI statistics
 	scanner := bufio.NewScanner(file)
@@ -75,8 +153,54 @@ func (p *FlatKeyValueParser) Parse(file io.Reader) (map[string]float64, error) {
 			level.Error(p.Logger).Log("err", fmt.Errorf("expected %d fields in KeyValue. Got %d", 2, len(parts)))
 			continue
 		}
-		metricName := fmt.Sprintf("%s_%s", p.MetricPrefix, parts[0])
-		metrics[metricName], _ = strconv.ParseFloat(parts[1], 64)
+		if excluded(p.ExcludeMetrics, parts[0]) {
+			continue
+		}
+		value, _ := strconv.ParseFloat(parts[1], 64)
+		metrics = append(metrics, Metric{
+			Name:      fmt.Sprintf("%s_%s", p.MetricPrefix, parts[0]),
+			Value:     value,
+			ValueType: valueType(p.ValueTypes[parts[0]]),
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		level.Error(p.Logger).Log("err", err)
+		return nil, err
+	}
+
+	return metrics, nil
+}
+
+func (p *DeviceKeyValueParser) Parse(file io.Reader) ([]Metric, error) {
+	var metrics []Metric
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		parts := strings.Fields(line)
+		if len(parts) < 2 {
+			level.Error(p.Logger).Log("err", fmt.Errorf("expected a device id followed by Key=Value fields. Got %q", line))
+			continue
+		}
+		device := parts[0]
+		for _, m := range parts[1:] {
+			field := strings.Split(m, "=")
+			if len(field) != 2 {
+				level.Error(p.Logger).Log("err", fmt.Errorf("failed to parse %s as Key=Value", m))
+				continue
+			}
+			if excluded(p.ExcludeMetrics, field[0]) {
+				continue
+			}
+			value, _ := strconv.ParseFloat(field[1], 64)
+			metrics = append(metrics, Metric{
+				Name:      fmt.Sprintf("%s_%s", p.MetricPrefix, field[0]),
+				Value:     value,
+				Labels:    map[string]string{"device": device},
+				ValueType: valueType(p.ValueTypes[field[0]]),
+			})
+		}
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -87,8 +211,8 @@ func (p *FlatKeyValueParser) Parse(file io.Reader) (map[string]float64, error) {
 	return metrics, nil
 }
 
-func (p *NestedKeyValueParser) Parse(file io.Reader) (map[string]float64, error) {
-	metrics := map[string]float64{}
+func (p *NestedKeyValueParser) Parse(file io.Reader) ([]Metric, error) {
+	var metrics []Metric
 
 	// Read the file line by line and parse
 	scanner := bufio.NewScanner(file)
@@ -106,8 +230,15 @@ func (p *NestedKeyValueParser) Parse(file io.Reader) (map[string]float64, error)
 				level.Error(p.Logger).Log("err", fmt.Errorf("failed to parse %s as Key=Value", m))
 				continue
 			}
-			metricName := fmt.Sprintf("%s_%s_%s", p.MetricPrefix, prefix, metric[0])
-			metrics[metricName], _ = strconv.ParseFloat(metric[1], 64)
+			if excluded(p.ExcludeMetrics, metric[0]) {
+				continue
+			}
+			value, _ := strconv.ParseFloat(metric[1], 64)
+			metrics = append(metrics, Metric{
+				Name:      fmt.Sprintf("%s_%s_%s", p.MetricPrefix, prefix, metric[0]),
+				Value:     value,
+				ValueType: valueType(p.ValueTypes[metric[0]]),
+			})
 		}
 	}
 
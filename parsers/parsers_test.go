@@ -1,16 +1,24 @@
 package parsers
 
 import (
-	"fmt"
 	"math"
 	"strings"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/common/promlog"
 )
 
 var logger = promlog.New(&promlog.Config{})
 
+func metricsByName(metrics []Metric) map[string]Metric {
+	byName := make(map[string]Metric, len(metrics))
+	for _, m := range metrics {
+		byName[m.Name] = m
+	}
+	return byName
+}
+
 func TestMultiKeyValueParser(t *testing.T) {
 	fileContent := `some avg10=1.23 avg60=4.56 avg300=7.89 total=1234
 full avg10=5.67 avg60=8.90 avg300=0.12 total=5678`
@@ -30,21 +38,31 @@ full avg10=5.67 avg60=8.90 avg300=0.12 total=5678`
 	parser := &NestedKeyValueParser{
 		MetricPrefix: "memory_pressure",
 		Logger:       logger,
+		ValueTypes:   map[string]prometheus.ValueType{"total": prometheus.CounterValue},
 	}
 	metrics, err := parser.Parse(file)
 	if err != nil {
 		t.Fatalf("Error calling Metrics: %v", err)
 	}
+	actual := metricsByName(metrics)
 	// Compare the actual metrics to the expected metrics
 	for metricName, expectedValue := range expectedMetrics {
-		actualValue, ok := metrics[metricName]
+		actualMetric, ok := actual[metricName]
 		if !ok {
 			t.Errorf("Metric %s not found in actual metrics", metricName)
 			continue
 		}
 
-		if actualValue != expectedValue {
-			t.Errorf("Metric %s has unexpected value. Expected: %f, Actual: %f", metricName, expectedValue, actualValue)
+		if actualMetric.Value != expectedValue {
+			t.Errorf("Metric %s has unexpected value. Expected: %f, Actual: %f", metricName, expectedValue, actualMetric.Value)
+		}
+
+		wantType := prometheus.GaugeValue
+		if strings.HasSuffix(metricName, "_total") {
+			wantType = prometheus.CounterValue
+		}
+		if actualMetric.ValueType != wantType {
+			t.Errorf("Metric %s has unexpected value type. Expected: %v, Actual: %v", metricName, wantType, actualMetric.ValueType)
 		}
 	}
 }
@@ -66,16 +84,17 @@ func TestSingleValueParser(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Error calling Metrics: %v", err)
 	}
+	actual := metricsByName(metrics)
 	// Compare the actual metrics to the expected metrics
 	for metricName, expectedValue := range expectedMetrics {
-		actualValue, ok := metrics[metricName]
+		actualMetric, ok := actual[metricName]
 		if !ok {
 			t.Errorf("Metric %s not found in actual metrics", metricName)
 			continue
 		}
 
-		if actualValue != expectedValue {
-			t.Errorf("Metric %s has unexpected value. Expected: %f, Actual: %f", metricName, expectedValue, actualValue)
+		if actualMetric.Value != expectedValue {
+			t.Errorf("Metric %s has unexpected value. Expected: %f, Actual: %f", metricName, expectedValue, actualMetric.Value)
 		}
 	}
 }
@@ -97,20 +116,40 @@ func TestMaxValue(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Error calling Metrics: %v", err)
 	}
+	actual := metricsByName(metrics)
 	// Compare the actual metrics to the expected metrics
 	for metricName, expectedValue := range expectedMetrics {
-		actualValue, ok := metrics[metricName]
+		actualMetric, ok := actual[metricName]
 		if !ok {
 			t.Errorf("Metric %s not found in actual metrics", metricName)
 			continue
 		}
 
-		if actualValue != expectedValue {
-			t.Errorf("Metric %s has unexpected value. Expected: %f, Actual: %f", metricName, expectedValue, actualValue)
+		if actualMetric.Value != expectedValue {
+			t.Errorf("Metric %s has unexpected value. Expected: %f, Actual: %f", metricName, expectedValue, actualMetric.Value)
 		}
 	}
 }
 
+func TestSingleValueParserExcludeMetrics(t *testing.T) {
+	fileContent := `5678`
+	file := strings.NewReader(fileContent)
+
+	parser := &SingleValueParser{
+		MetricPrefix:   "memory_current",
+		Logger:         logger,
+		ExcludeMetrics: []string{"memory_current"},
+	}
+
+	metrics, err := parser.Parse(file)
+	if err != nil {
+		t.Fatalf("Error calling Metrics: %v", err)
+	}
+	if len(metrics) != 0 {
+		t.Errorf("expected no metrics, got %+v", metrics)
+	}
+}
+
 func TestKeyValueParser(t *testing.T) {
 	fileContent := `low 0
 	high 5335362
@@ -134,20 +173,137 @@ func TestKeyValueParser(t *testing.T) {
 	}
 
 	metrics, err := parser.Parse(file)
-	fmt.Print(metrics)
 	if err != nil {
 		t.Fatalf("Error calling Metrics: %v", err)
 	}
+	actual := metricsByName(metrics)
 	// Compare the actual metrics to the expected metrics
 	for metricName, expectedValue := range expectedMetrics {
-		actualValue, ok := metrics[metricName]
+		actualMetric, ok := actual[metricName]
 		if !ok {
 			t.Errorf("Metric %s not found in actual metrics", metricName)
 			continue
 		}
 
-		if actualValue != expectedValue {
-			t.Errorf("Metric %s has unexpected value. Expected: %f, Actual: %f", metricName, expectedValue, actualValue)
+		if actualMetric.Value != expectedValue {
+			t.Errorf("Metric %s has unexpected value. Expected: %f, Actual: %f", metricName, expectedValue, actualMetric.Value)
+		}
+	}
+}
+
+func TestKeyValueParserExcludeMetrics(t *testing.T) {
+	fileContent := `low 0
+	high 5335362
+	max 0
+	oom 0
+	oom_kill 0
+`
+	file := strings.NewReader(fileContent)
+
+	parser := &FlatKeyValueParser{
+		MetricPrefix:   "memory_events",
+		Logger:         logger,
+		ExcludeMetrics: []string{"oom*"},
+	}
+
+	metrics, err := parser.Parse(file)
+	if err != nil {
+		t.Fatalf("Error calling Metrics: %v", err)
+	}
+	actual := metricsByName(metrics)
+	for _, excluded := range []string{"memory_events_oom", "memory_events_oom_kill"} {
+		if _, ok := actual[excluded]; ok {
+			t.Errorf("expected %s to be excluded, got %+v", excluded, metrics)
+		}
+	}
+	if _, ok := actual["memory_events_low"]; !ok {
+		t.Errorf("expected memory_events_low to be present, got %+v", metrics)
+	}
+}
+
+func TestDeviceKeyValueParser(t *testing.T) {
+	fileContent := `254:0 rbytes=1206272 wbytes=0 rios=12 wios=0 dbytes=0 dios=0
+254:16 rbytes=4096 wbytes=8192 rios=1 wios=2 dbytes=0 dios=0`
+	file := strings.NewReader(fileContent)
+
+	parser := &DeviceKeyValueParser{
+		MetricPrefix: "io_stat",
+		Logger:       logger,
+		ValueTypes:   map[string]prometheus.ValueType{"rbytes": prometheus.CounterValue},
+	}
+
+	metrics, err := parser.Parse(file)
+	if err != nil {
+		t.Fatalf("Error calling Metrics: %v", err)
+	}
+
+	var found bool
+	for _, m := range metrics {
+		if m.Name != "io_stat_rbytes" || m.Labels["device"] != "254:0" {
+			continue
+		}
+		found = true
+		if m.Value != 1206272 {
+			t.Errorf("unexpected value for %s{device=%q}: got %f", m.Name, m.Labels["device"], m.Value)
+		}
+		if m.ValueType != prometheus.CounterValue {
+			t.Errorf("unexpected value type for %s: got %v, want CounterValue", m.Name, m.ValueType)
+		}
+	}
+	if !found {
+		t.Fatalf("expected metric io_stat_rbytes with device=254:0, got %+v", metrics)
+	}
+
+	for _, m := range metrics {
+		if m.Name == "io_stat_wbytes" && m.Labels["device"] == "254:16" && m.Value != 8192 {
+			t.Errorf("unexpected value for %s{device=%q}: got %f", m.Name, m.Labels["device"], m.Value)
+		}
+	}
+}
+
+func TestDeviceKeyValueParserExcludeMetrics(t *testing.T) {
+	fileContent := `254:0 rbytes=1206272 wbytes=0 rios=12 wios=0 dbytes=0 dios=0`
+	file := strings.NewReader(fileContent)
+
+	parser := &DeviceKeyValueParser{
+		MetricPrefix:   "io_stat",
+		Logger:         logger,
+		ExcludeMetrics: []string{"wbytes"},
+	}
+
+	metrics, err := parser.Parse(file)
+	if err != nil {
+		t.Fatalf("Error calling Metrics: %v", err)
+	}
+	for _, m := range metrics {
+		if m.Name == "io_stat_wbytes" {
+			t.Errorf("expected io_stat_wbytes to be excluded, got %+v", metrics)
+		}
+	}
+}
+
+func TestNestedKeyValueParserExcludeMetrics(t *testing.T) {
+	fileContent := `some avg10=1.23 avg60=4.56 avg300=7.89 total=1234
+full avg10=5.67 avg60=8.90 avg300=0.12 total=5678`
+	file := strings.NewReader(fileContent)
+
+	parser := &NestedKeyValueParser{
+		MetricPrefix:   "memory_pressure",
+		Logger:         logger,
+		ExcludeMetrics: []string{"avg*"},
+	}
+
+	metrics, err := parser.Parse(file)
+	if err != nil {
+		t.Fatalf("Error calling Metrics: %v", err)
+	}
+	actual := metricsByName(metrics)
+	for name := range actual {
+		if strings.Contains(name, "avg") {
+			t.Errorf("expected %s to be excluded, got %+v", name, metrics)
 		}
 	}
+	if _, ok := actual["memory_pressure_some_total"]; !ok {
+		t.Errorf("expected memory_pressure_some_total to be present, got %+v", metrics)
+	}
 }